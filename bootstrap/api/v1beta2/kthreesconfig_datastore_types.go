@@ -0,0 +1,60 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import corev1 "k8s.io/api/core/v1"
+
+// DatastoreType describes which backend k3s uses to persist cluster state.
+type DatastoreType string
+
+const (
+	// EmbeddedEtcdDatastoreType is k3s' default embedded etcd datastore. This is the behavior of KThreesConfig
+	// when Datastore is unset.
+	EmbeddedEtcdDatastoreType DatastoreType = "embedded-etcd"
+
+	// ExternalDatastoreType is any datastore k3s reaches through kine (MySQL, PostgreSQL, external etcd, ...),
+	// addressed by Endpoint.
+	ExternalDatastoreType DatastoreType = "external"
+)
+
+// DatastoreSpec configures which backend k3s uses to persist cluster state. When Type is empty or
+// EmbeddedEtcdDatastoreType, KThreesControlPlane manages an embedded etcd cluster as it does today. When Type is
+// ExternalDatastoreType, etcd member management is a no-op and Endpoint/CASecretRef/CertSecretRef are passed
+// through to k3s as --datastore-endpoint and friends.
+type DatastoreSpec struct {
+	// Type selects the datastore backend. Defaults to EmbeddedEtcdDatastoreType.
+	// +optional
+	// +kubebuilder:validation:Enum=embedded-etcd;external
+	Type DatastoreType `json:"type,omitempty"`
+
+	// Endpoint is the kine-compatible datastore connection string (e.g. a MySQL or PostgreSQL DSN), passed to
+	// k3s as --datastore-endpoint. Required when Type is ExternalDatastoreType.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// CASecretRef references a Secret containing the CA certificate used to verify the datastore endpoint.
+	// +optional
+	CASecretRef *corev1.SecretReference `json:"caSecretRef,omitempty"`
+
+	// CertSecretRef references a Secret containing the client certificate and key k3s uses to authenticate to
+	// the datastore endpoint.
+	// +optional
+	CertSecretRef *corev1.SecretReference `json:"certSecretRef,omitempty"`
+}
+
+// IsExternal reports whether spec describes an external (non-embedded-etcd) datastore.
+func (spec *DatastoreSpec) IsExternal() bool {
+	return spec != nil && spec.Type == ExternalDatastoreType
+}
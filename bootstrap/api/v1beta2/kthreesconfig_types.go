@@ -0,0 +1,112 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KThreesConfigSpec defines the desired state of KThreesConfig.
+type KThreesConfigSpec struct {
+	// Version is the k3s version to install. Usually left empty and inherited from the owning
+	// KThreesControlPlane/MachineDeployment.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Datastore selects and configures the backend k3s uses to persist cluster state. If unset, k3s uses its
+	// default embedded etcd datastore.
+	// +optional
+	Datastore *DatastoreSpec `json:"datastore,omitempty"`
+}
+
+// KThreesConfigStatus defines the observed state of KThreesConfig.
+type KThreesConfigStatus struct {
+	// Ready indicates the BootstrapData secret is available.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// DataSecretName is the name of the secret that stores the bootstrap data script.
+	// +optional
+	DataSecretName *string `json:"dataSecretName,omitempty"`
+
+	// FailureReason will be set on non-retryable errors.
+	// +optional
+	FailureReason string `json:"failureReason,omitempty"`
+
+	// FailureMessage will be set on non-retryable errors.
+	// +optional
+	FailureMessage string `json:"failureMessage,omitempty"`
+
+	// ObservedGeneration is the latest generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=kthreesconfigs,scope=Namespaced,categories=cluster-api
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+
+// KThreesConfig is the Schema for the kthreesconfigs API.
+type KThreesConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KThreesConfigSpec   `json:"spec,omitempty"`
+	Status KThreesConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KThreesConfigList contains a list of KThreesConfig.
+type KThreesConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KThreesConfig `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+
+// KThreesConfigTemplate is the Schema for the kthreesconfigtemplates API.
+type KThreesConfigTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KThreesConfigTemplateSpec `json:"spec,omitempty"`
+}
+
+// KThreesConfigTemplateSpec defines the desired state of KThreesConfigTemplate.
+type KThreesConfigTemplateSpec struct {
+	Template KThreesConfigTemplateResource `json:"template"`
+}
+
+// KThreesConfigTemplateResource defines the Template struct.
+type KThreesConfigTemplateResource struct {
+	Spec KThreesConfigSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KThreesConfigTemplateList contains a list of KThreesConfigTemplate.
+type KThreesConfigTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KThreesConfigTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KThreesConfig{}, &KThreesConfigList{})
+	SchemeBuilder.Register(&KThreesConfigTemplate{}, &KThreesConfigTemplateList{})
+}
@@ -0,0 +1,44 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+const (
+	// MachinesSpecUpToDateCondition documents that the spec of the machines controlled by the KThreesControlPlane
+	// is up to date.
+	MachinesSpecUpToDateCondition clusterv1.ConditionType = "MachinesSpecUpToDate"
+
+	// RemediationCondition documents the status of the most recent attempt to remediate an unhealthy control
+	// plane Machine. It is marked True on a successful remediation and False, with RemediationFailedReason, when
+	// remediation was refused.
+	RemediationCondition clusterv1.ConditionType = "Remediation"
+)
+
+const (
+	// RemediationInProgressAnnotation is set on a KThreesControlPlane once the controller has remediated an
+	// unhealthy control plane Machine (forwarding etcd leadership, removing the etcd member, and deleting the
+	// Machine). Its value is a comma-separated list of Unix timestamps in seconds, one per remediation attempt,
+	// and is used to rate-limit retries by RetryPeriod/MaxRetry independent of controller restarts.
+	RemediationInProgressAnnotation = "controlplane.cluster.x-k8s.io/remediation-in-progress"
+)
+
+const (
+	// RemediationFailedReason is used when remediation of an unhealthy Machine could not be completed, for
+	// example because removing it would drop etcd below quorum or MaxRetry has been exceeded.
+	RemediationFailedReason = "RemediationFailed"
+)
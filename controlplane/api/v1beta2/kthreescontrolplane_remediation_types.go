@@ -0,0 +1,42 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RemediationStrategy controls how the KThreesControlPlane controller reacts to control plane Machines marked
+// unhealthy by a MachineHealthCheck.
+type RemediationStrategy struct {
+	// MaxRetry is the maximum number of remediation retries allowed for the control plane before remediation is
+	// no longer attempted and the KThreesControlPlane is marked with RemediationFailedReason. A retry is
+	// consumed every time remediation is attempted for a Machine, even if a previous attempt was for a
+	// different Machine. Defaults to 3 if not set.
+	// +optional
+	MaxRetry *int32 `json:"maxRetry,omitempty"`
+
+	// RetryPeriod is the duration that the KThreesControlPlane controller has to wait before remediating the
+	// next unhealthy Machine after the previous remediation attempt. Defaults to 5m if not set.
+	// +optional
+	RetryPeriod metav1.Duration `json:"retryPeriod,omitempty"`
+
+	// MinHealthyPeriod defines how long a remediation attempt keeps counting against MaxRetry: attempts older
+	// than MinHealthyPeriod are dropped from the count. Defaults to 1h if not set.
+	// +optional
+	MinHealthyPeriod metav1.Duration `json:"minHealthyPeriod,omitempty"`
+}
@@ -0,0 +1,152 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+)
+
+// KThreesControlPlaneSpec defines the desired state of KThreesControlPlane.
+type KThreesControlPlaneSpec struct {
+	// Replicas is the number of desired control plane Machines.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Version is the k3s version to run on control plane Machines.
+	Version string `json:"version"`
+
+	// MachineTemplate describes how control plane Machines and their InfraMachines are generated.
+	MachineTemplate KThreesControlPlaneMachineTemplate `json:"machineTemplate"`
+
+	// KThreesConfigSpec is the bootstrap configuration applied to every control plane Machine.
+	KThreesConfigSpec bootstrapv1.KThreesConfigSpec `json:"kthreesConfigSpec"`
+
+	// RemediationStrategy configures how unhealthy control plane Machines (as flagged by a MachineHealthCheck)
+	// are remediated.
+	// +optional
+	RemediationStrategy *RemediationStrategy `json:"remediationStrategy,omitempty"`
+
+	// EtcdSnapshot configures scheduled etcd snapshots and drives snapshot restores.
+	// +optional
+	EtcdSnapshot *EtcdSnapshotSpec `json:"etcdSnapshot,omitempty"`
+}
+
+// KThreesControlPlaneMachineTemplate describes the Machines and InfraMachines generated for a KThreesControlPlane.
+type KThreesControlPlaneMachineTemplate struct {
+	// Metadata is applied to every generated Machine.
+	// +optional
+	Metadata clusterv1.ObjectMeta `json:"metadata,omitempty"`
+
+	// InfrastructureRef references the InfraMachineTemplate used to generate InfraMachines.
+	InfrastructureRef corev1.ObjectReference `json:"infrastructureRef"`
+
+	// NodeDrainTimeout is the total amount of time a control plane Machine may take to drain before deletion
+	// proceeds anyway.
+	// +optional
+	NodeDrainTimeout *metav1.Duration `json:"nodeDrainTimeout,omitempty"`
+}
+
+// KThreesControlPlaneStatus defines the observed state of KThreesControlPlane.
+type KThreesControlPlaneStatus struct {
+	// Selector is the label selector in string form for Machines owned by this control plane.
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// Replicas is the number of control plane Machines.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// ReadyReplicas is the number of control plane Machines with a ready Node.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// UpdatedReplicas is the number of control plane Machines on the current spec.
+	// +optional
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
+
+	// UnavailableReplicas is the number of control plane Machines that are not yet ready.
+	// +optional
+	UnavailableReplicas int32 `json:"unavailableReplicas,omitempty"`
+
+	// Initialized is true once the control plane has been initialized and is ready to accept requests.
+	// +optional
+	Initialized bool `json:"initialized,omitempty"`
+
+	// Ready denotes the control plane is ready to accept requests.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// FailureReason indicates a terminal problem reconciling the control plane.
+	// +optional
+	FailureReason string `json:"failureReason,omitempty"`
+
+	// FailureMessage is a human-readable description of FailureReason.
+	// +optional
+	FailureMessage string `json:"failureMessage,omitempty"`
+
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions defines current observed state of the KThreesControlPlane.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=kthreescontrolplanes,scope=Namespaced,categories=cluster-api,shortName=ktcp
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready"
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas"
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".spec.version"
+
+// KThreesControlPlane is the Schema for the kthreescontrolplanes API.
+type KThreesControlPlane struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KThreesControlPlaneSpec   `json:"spec,omitempty"`
+	Status KThreesControlPlaneStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KThreesControlPlaneList contains a list of KThreesControlPlane.
+type KThreesControlPlaneList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KThreesControlPlane `json:"items"`
+}
+
+// GetConditions returns the set of conditions for this object.
+func (r *KThreesControlPlane) GetConditions() clusterv1.Conditions {
+	return r.Status.Conditions
+}
+
+// SetConditions sets the conditions on this object.
+func (r *KThreesControlPlane) SetConditions(conditions clusterv1.Conditions) {
+	r.Status.Conditions = conditions
+}
+
+func init() {
+	SchemeBuilder.Register(&KThreesControlPlane{}, &KThreesControlPlaneList{})
+}
@@ -0,0 +1,127 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EtcdSnapshotSpec configures scheduled etcd snapshots for a KThreesControlPlane.
+type EtcdSnapshotSpec struct {
+	// Schedule is a cron expression controlling how often a snapshot is taken. If empty, scheduled snapshots
+	// are disabled and the controller takes no snapshots. KThreesEtcdSnapshot objects record snapshots the
+	// controller has taken; creating one does not take a snapshot.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Retention is the number of snapshots to keep; older snapshots are pruned after each scheduled run.
+	// Defaults to 5 if not set.
+	// +optional
+	Retention *int32 `json:"retention,omitempty"`
+
+	// S3 configures uploading snapshots to S3-compatible object storage, in addition to local storage on the
+	// control plane node. If nil, snapshots are kept locally only.
+	// +optional
+	S3 *EtcdSnapshotS3Spec `json:"s3,omitempty"`
+
+	// RestoreFromSnapshot, when set, triggers a restore: the control plane is scaled down to a single node,
+	// that node is restored from the named snapshot via `k3s server --cluster-reset`, and the field is then
+	// cleared. The KThreesControlPlane controller does not scale the control plane back up to its configured
+	// replica count afterwards.
+	// +optional
+	RestoreFromSnapshot *string `json:"restoreFromSnapshot,omitempty"`
+}
+
+// EtcdSnapshotS3Spec configures uploading/reading snapshots from an S3-compatible bucket.
+type EtcdSnapshotS3Spec struct {
+	// Endpoint is the S3-compatible API endpoint.
+	Endpoint string `json:"endpoint"`
+
+	// Bucket is the bucket snapshots are stored in.
+	Bucket string `json:"bucket"`
+
+	// Region is the bucket's region, if required by the endpoint.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// AccessKeySecretRef references a Secret with "accessKey" and "secretKey" keys used to authenticate to the
+	// endpoint.
+	AccessKeySecretRef corev1.SecretReference `json:"accessKeySecretRef"`
+}
+
+// KThreesEtcdSnapshotSpec records the snapshot a KThreesEtcdSnapshot represents.
+type KThreesEtcdSnapshotSpec struct {
+	// ClusterName is the Cluster this snapshot was taken from.
+	ClusterName string `json:"clusterName"`
+
+	// SnapshotName is the name k3s gave the snapshot (the `k3s etcd-snapshot` artifact name).
+	SnapshotName string `json:"snapshotName"`
+}
+
+// KThreesEtcdSnapshotStatus reports the outcome of taking a snapshot.
+type KThreesEtcdSnapshotStatus struct {
+	// Ready is true once the snapshot has been taken successfully and is available for restore.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// CreationTime is when the snapshot was taken, as reported by k3s.
+	// +optional
+	CreationTime *metav1.Time `json:"creationTime,omitempty"`
+
+	// Size is the snapshot size in bytes, as reported by k3s.
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// Locations lists where the snapshot is stored (e.g. "local", or an S3 URI).
+	// +optional
+	Locations []string `json:"locations,omitempty"`
+
+	// FailureMessage records why the snapshot failed, if it did.
+	// +optional
+	FailureMessage string `json:"failureMessage,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=kthreesetcdsnapshots,scope=Namespaced,categories=cluster-api,shortName=k3ses
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterName"
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KThreesEtcdSnapshot records the metadata and status of a single etcd snapshot taken for a cluster's
+// KThreesControlPlane.
+type KThreesEtcdSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KThreesEtcdSnapshotSpec   `json:"spec,omitempty"`
+	Status KThreesEtcdSnapshotStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KThreesEtcdSnapshotList contains a list of KThreesEtcdSnapshot.
+type KThreesEtcdSnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KThreesEtcdSnapshot `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KThreesEtcdSnapshot{}, &KThreesEtcdSnapshotList{})
+}
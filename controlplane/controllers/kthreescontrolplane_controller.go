@@ -0,0 +1,167 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package controllers implements the controllers for the KThreesControlPlane API.
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/collections"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	"github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// KThreesControlPlaneReconciler reconciles a KThreesControlPlane object.
+type KThreesControlPlaneReconciler struct {
+	Client client.Client
+}
+
+// Reconcile loads the KThreesControlPlane and the Machines it owns, builds a k3s.ControlPlane for them, and
+// dispatches to reconcileDelete or reconcileNormal.
+func (r *KThreesControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	kcp := &controlplanev1.KThreesControlPlane{}
+	if err := r.Client.Get(ctx, req.NamespacedName, kcp); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	cluster, err := util.GetOwnerCluster(ctx, r.Client, kcp.ObjectMeta)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to get owner cluster")
+	}
+	if cluster == nil {
+		return ctrl.Result{}, nil
+	}
+
+	ownedMachines, err := collections.GetFilteredMachinesForCluster(ctx, r.Client, cluster, collections.OwnedMachines(kcp))
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to list machines owned by control plane")
+	}
+
+	controlPlane := k3s.NewControlPlane(r.Client, cluster, kcp, ownedMachines)
+
+	if !kcp.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, controlPlane)
+	}
+
+	return r.reconcileNormal(ctx, controlPlane)
+}
+
+// reconcileDelete runs the pre-terminate hook for any control plane Machine already being deleted, so a
+// KThreesControlPlane deletion still removes etcd members cleanly machine by machine.
+func (r *KThreesControlPlaneReconciler) reconcileDelete(ctx context.Context, controlPlane *k3s.ControlPlane) (ctrl.Result, error) {
+	return r.reconcileDeletingMachines(ctx, controlPlane)
+}
+
+// reconcileDeletingMachines runs the pre-terminate hook for every control plane Machine that already has a
+// DeletionTimestamp, regardless of whether the KThreesControlPlane itself is being deleted.
+func (r *KThreesControlPlaneReconciler) reconcileDeletingMachines(ctx context.Context, controlPlane *k3s.ControlPlane) (ctrl.Result, error) {
+	for _, machine := range controlPlane.Machines.Filter(collections.HasDeletionTimestamp) {
+		res, err := r.reconcilePreTerminateHook(ctx, controlPlane, machine)
+		if err != nil || !res.IsZero() {
+			return res, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcileNormal runs the control plane reconciliation steps for a KThreesControlPlane that is not being
+// deleted.
+func (r *KThreesControlPlaneReconciler) reconcileNormal(ctx context.Context, controlPlane *k3s.ControlPlane) (ctrl.Result, error) {
+	if res, err := r.reconcileDeletingMachines(ctx, controlPlane); err != nil || !res.IsZero() {
+		return res, err
+	}
+
+	if err := r.ensurePreTerminateHookAnnotations(ctx, controlPlane); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	datastoreProvider, err := r.datastoreProviderFor(ctx, controlPlane)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := datastoreProvider.HealthCheck(ctx); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "datastore health check failed")
+	}
+
+	// auditEtcdMembers, reconcileUnhealthyMachines, and etcd snapshotting all operate on membership/backup state
+	// that only exists for embedded etcd. With an external datastore, k3s nodes reach it over kine independent
+	// of which control plane Machines are alive, so there is no membership or etcd state for this controller to
+	// manage. These steps run only for EmbeddedEtcdProvider. auditEtcdMembers and reconcileUnhealthyMachines
+	// take datastoreProvider; the snapshot steps call the workload cluster directly.
+	if _, embeddedEtcd := datastoreProvider.(*k3s.EmbeddedEtcdProvider); embeddedEtcd {
+		if err := r.auditEtcdMembers(ctx, controlPlane, datastoreProvider); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if res, err := r.reconcileUnhealthyMachines(ctx, controlPlane, datastoreProvider); err != nil || !res.IsZero() {
+			return res, err
+		}
+
+		if res, err := r.reconcileEtcdSnapshotRestore(ctx, controlPlane); err != nil || !res.IsZero() {
+			return res, err
+		}
+
+		workload, err := controlPlane.GetWorkloadCluster(ctx)
+		if err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to get remote client for workload cluster")
+		}
+		if err := r.reconcileEtcdSnapshotSchedule(ctx, workload, controlPlane.KCP); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.reconcileMachineAdoption(ctx, controlPlane); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// ensurePreTerminateHookAnnotations stamps k3s.PreTerminateHookCleanupAnnotation onto every control plane
+// Machine that doesn't yet have it. Machine creation itself happens outside this controller (in the, not yet
+// implemented, KTCP scale-up path), so this reconcile-time pass is what actually guarantees every control plane
+// Machine ends up gated on etcd member removal before deletion.
+func (r *KThreesControlPlaneReconciler) ensurePreTerminateHookAnnotations(ctx context.Context, controlPlane *k3s.ControlPlane) error {
+	for _, machine := range controlPlane.Machines.Filter(collections.Not(collections.HasDeletionTimestamp)) {
+		if !k3s.EnsurePreTerminateHookAnnotation(machine) {
+			continue
+		}
+		if err := r.Client.Update(ctx, machine); err != nil {
+			return errors.Wrapf(err, "failed to add pre-terminate hook annotation to machine %q", machine.Name)
+		}
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *KThreesControlPlaneReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&controlplanev1.KThreesControlPlane{}).
+		Owns(&clusterv1.Machine{}).
+		Complete(r)
+}
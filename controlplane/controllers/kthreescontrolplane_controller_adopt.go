@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/blang/semver"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	"github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// reconcileMachineAdoption lists control plane Machines for controlPlane.Cluster that are not yet owned by
+// controlPlane.KCP and adopts the eligible ones. Candidates are found by label rather than
+// controlPlane.Machines, since that collections.Machines was itself built with an owned-by-kcp filter and so
+// never contains the Machines adoption exists to pick up.
+func (r *KThreesControlPlaneReconciler) reconcileMachineAdoption(ctx context.Context, controlPlane *k3s.ControlPlane) error {
+	candidates, err := collections.GetFilteredMachinesForCluster(ctx, r.Client, controlPlane.Cluster,
+		collections.ControlPlaneMachines(controlPlane.Cluster.Name),
+		collections.Not(collections.OwnedMachines(controlPlane.KCP)),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to list unowned control plane machines")
+	}
+	if candidates.Len() == 0 {
+		return nil
+	}
+
+	return r.adoptMachines(ctx, controlPlane.KCP, controlPlane.Cluster, candidates.UnsortedList())
+}
+
+// adoptMachines takes ownership of pre-existing control plane Machines that belong to cluster but are not yet
+// owned by kcp. This covers imported clusters, or clusters whose control plane was previously managed by a
+// different controller. For every eligible Machine it pivots ownership of the Machine, its KThreesConfig, and
+// any secrets generated for it (kubeconfig, CA/PKI material, join token) to kcp, and aligns the Machine and
+// KThreesConfig to kcp's current version so adoption alone never triggers a rollout: IsRollingOut (and
+// kcpVersionWithinOneMinor below) only ever compare against Spec.Version, so a mismatch there - not a hash - is
+// what would otherwise cause an adopted Machine to be rolled immediately.
+func (r *KThreesControlPlaneReconciler) adoptMachines(ctx context.Context, kcp *controlplanev1.KThreesControlPlane, cluster *clusterv1.Cluster, machines []*clusterv1.Machine) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	if !kcp.DeletionTimestamp.IsZero() {
+		return errors.New("refusing to adopt machines into a KThreesControlPlane that is being deleted")
+	}
+
+	for _, machine := range machines {
+		if util.HasOwner(machine.OwnerReferences, controlplanev1.GroupVersion.String(), []string{"KThreesControlPlane"}) {
+			continue
+		}
+
+		config, err := r.kThreesConfigForMachine(ctx, machine)
+		if err != nil {
+			log.Info("skipping adoption, machine was not bootstrapped with KThreesConfig", "machine", machine.Name, "reason", err.Error())
+			continue
+		}
+
+		if err := kcpVersionWithinOneMinor(kcp.Spec.Version, config.Spec.Version); err != nil {
+			log.Info("skipping adoption, k3s version drift exceeds one minor", "machine", machine.Name, "reason", err.Error())
+			continue
+		}
+
+		if err := r.adoptMachine(ctx, kcp, machine, config); err != nil {
+			return errors.Wrapf(err, "failed to adopt machine %q", machine.Name)
+		}
+		log.Info("adopted pre-existing control plane machine", "machine", machine.Name)
+	}
+
+	return nil
+}
+
+func (r *KThreesControlPlaneReconciler) adoptMachine(ctx context.Context, kcp *controlplanev1.KThreesControlPlane, machine *clusterv1.Machine, config *bootstrapv1.KThreesConfig) error {
+	controllerOwnerRef := *ownerRefForKThreesControlPlane(kcp)
+
+	machine.OwnerReferences = util.EnsureOwnerRef(machine.OwnerReferences, controllerOwnerRef)
+	machine.Spec.Version = &kcp.Spec.Version
+	if err := r.Client.Update(ctx, machine); err != nil {
+		return errors.Wrap(err, "failed to update machine owner references")
+	}
+
+	config.OwnerReferences = util.EnsureOwnerRef(config.OwnerReferences, controllerOwnerRef)
+	config.Spec.Version = kcp.Spec.Version
+	if err := r.Client.Update(ctx, config); err != nil {
+		return errors.Wrap(err, "failed to update KThreesConfig owner references")
+	}
+
+	for _, secretSuffix := range []string{"kubeconfig", "ca", "token"} {
+		secret := &corev1.Secret{}
+		key := client.ObjectKey{Namespace: machine.Namespace, Name: machine.Spec.ClusterName + "-" + secretSuffix}
+		if err := r.Client.Get(ctx, key, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to get %s secret", secretSuffix)
+		}
+		secret.OwnerReferences = util.EnsureOwnerRef(secret.OwnerReferences, controllerOwnerRef)
+		if err := r.Client.Update(ctx, secret); err != nil {
+			return errors.Wrapf(err, "failed to update %s secret owner references", secretSuffix)
+		}
+	}
+
+	return nil
+}
+
+func (r *KThreesControlPlaneReconciler) kThreesConfigForMachine(ctx context.Context, machine *clusterv1.Machine) (*bootstrapv1.KThreesConfig, error) {
+	if machine.Spec.Bootstrap.ConfigRef == nil || machine.Spec.Bootstrap.ConfigRef.Kind != "KThreesConfig" {
+		return nil, errors.New("machine bootstrap.configRef is not a KThreesConfig")
+	}
+
+	config := &bootstrapv1.KThreesConfig{}
+	key := client.ObjectKey{Namespace: machine.Namespace, Name: machine.Spec.Bootstrap.ConfigRef.Name}
+	if err := r.Client.Get(ctx, key, config); err != nil {
+		return nil, errors.Wrap(err, "failed to get KThreesConfig")
+	}
+
+	return config, nil
+}
+
+// kcpVersionWithinOneMinor returns an error if candidate's minor version differs from target's by more than one.
+func kcpVersionWithinOneMinor(target, candidate string) error {
+	targetVersion, err := semver.ParseTolerant(target)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse target version %q", target)
+	}
+	candidateVersion, err := semver.ParseTolerant(candidate)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse candidate version %q", candidate)
+	}
+
+	if targetVersion.Major != candidateVersion.Major {
+		return errors.Errorf("major version drift: %s vs %s", target, candidate)
+	}
+
+	diff := int64(targetVersion.Minor) - int64(candidateVersion.Minor)
+	if diff > 1 || diff < -1 {
+		return errors.Errorf("minor version drift exceeds one: %s vs %s", target, candidate)
+	}
+
+	return nil
+}
+
+func ownerRefForKThreesControlPlane(kcp *controlplanev1.KThreesControlPlane) *metav1.OwnerReference {
+	return &metav1.OwnerReference{
+		APIVersion: controlplanev1.GroupVersion.String(),
+		Kind:       "KThreesControlPlane",
+		Name:       kcp.Name,
+		UID:        kcp.UID,
+		Controller: boolPtr(true),
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestKcpVersionWithinOneMinor(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(kcpVersionWithinOneMinor("v1.28.3+k3s1", "v1.28.1+k3s2")).To(Succeed())
+	g.Expect(kcpVersionWithinOneMinor("v1.28.3+k3s1", "v1.27.9+k3s1")).To(Succeed())
+	g.Expect(kcpVersionWithinOneMinor("v1.28.3+k3s1", "v1.29.0+k3s1")).To(Succeed())
+
+	g.Expect(kcpVersionWithinOneMinor("v1.28.3+k3s1", "v1.26.5+k3s1")).To(HaveOccurred(), "two minor versions apart should be rejected")
+	g.Expect(kcpVersionWithinOneMinor("v1.28.3+k3s1", "v2.0.0+k3s1")).To(HaveOccurred(), "major version drift should be rejected")
+	g.Expect(kcpVersionWithinOneMinor("not-a-version", "v1.28.1+k3s1")).To(HaveOccurred())
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// auditEtcdMembers force-removes datastore members that have no corresponding control plane Machine and are old
+// enough that they can no longer be explained by a Machine still joining. Without this, a control plane Machine
+// that fails to bootstrap can leave behind an etcd member that reconcileEtcdMember never matches (it only looks
+// members up by node name), wedging quorum for every subsequent reconcile. It goes through datastoreProvider
+// rather than the workload cluster directly, so the behavior stays correct for whatever backend the cluster is
+// actually configured with.
+func (r *KThreesControlPlaneReconciler) auditEtcdMembers(ctx context.Context, controlPlane *k3s.ControlPlane, datastoreProvider k3s.DatastoreProvider) error {
+	if err := datastoreProvider.ReconcileMembers(ctx, controlPlane.Machines.UnsortedList()); err != nil {
+		return errors.Wrap(err, "failed to audit etcd members")
+	}
+
+	return nil
+}
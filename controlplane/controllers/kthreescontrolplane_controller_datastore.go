@@ -0,0 +1,37 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// datastoreProviderFor picks the k3s.DatastoreProvider for controlPlane's cluster based on its
+// KThreesConfigSpec.Datastore, so the reconcile loop never tries to manage etcd membership for a cluster that
+// isn't actually running embedded etcd.
+func (r *KThreesControlPlaneReconciler) datastoreProviderFor(ctx context.Context, controlPlane *k3s.ControlPlane) (k3s.DatastoreProvider, error) {
+	workload, err := controlPlane.GetWorkloadCluster(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get remote client for workload cluster")
+	}
+
+	return k3s.NewDatastoreProvider(workload, controlPlane.KCP.Spec.KThreesConfigSpec.Datastore), nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// reconcilePreTerminateHook is invoked for control plane Machines that have a DeletionTimestamp set and still carry
+// k3s.PreTerminateHookCleanupAnnotation. It requests removal of the Machine's etcd member by annotating its node,
+// forwarding leadership off it first if required, and only removes the annotation (unblocking CAPI's deletion of the Machine) once the
+// member is confirmed gone. This closes the race where the infrastructure provider deletes the node before k3s
+// has a chance to leave the etcd cluster gracefully.
+func (r *KThreesControlPlaneReconciler) reconcilePreTerminateHook(ctx context.Context, controlPlane *k3s.ControlPlane, machine *clusterv1.Machine) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if _, exists := machine.Annotations[k3s.PreTerminateHookCleanupAnnotation]; !exists {
+		return ctrl.Result{}, nil
+	}
+
+	workload, err := controlPlane.GetWorkloadCluster(ctx)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to get remote client for workload cluster")
+	}
+
+	if leaderCandidate := controlPlane.HealthyMachineOtherThan(machine); leaderCandidate != nil {
+		if err := workload.ForwardEtcdLeadership(ctx, machine, leaderCandidate); err != nil {
+			log.Error(err, "failed to forward etcd leadership ahead of machine deletion, retrying")
+			return ctrl.Result{Requeue: true}, nil
+		}
+	}
+
+	removed, err := workload.RemoveEtcdMemberForMachine(ctx, machine)
+	if err != nil {
+		log.Error(err, "failed to remove etcd member for machine, retrying")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if !removed {
+		// RemoveEtcdMemberForMachine only annotated the node for asynchronous removal; requeue until the member
+		// has actually left the cluster.
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	gone, err := workload.EtcdMemberRemovedForMachine(ctx, machine)
+	if err != nil {
+		log.Error(err, "failed to confirm etcd member removal, retrying")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if !gone {
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	log.Info("etcd member removed, clearing pre-terminate hook", "machine", machine.Name)
+	delete(machine.Annotations, k3s.PreTerminateHookCleanupAnnotation)
+	return ctrl.Result{}, r.Client.Update(ctx, machine)
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	"github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+const (
+	defaultRemediationMaxRetry         = int32(3)
+	defaultRemediationRetryPeriod      = 5 * time.Minute
+	defaultRemediationMinHealthyPeriod = 1 * time.Hour
+)
+
+// reconcileUnhealthyMachines remediates control plane Machines that a MachineHealthCheck has marked for owner
+// remediation (clusterv1.MachineOwnerRemediatedCondition is False). It forwards etcd leadership and removes the
+// etcd member before deleting the Machine, so the replacement rolled by MachineSet/KTCP scale-up never races
+// etcd membership. Remediation is skipped outright if a rollout is already underway, and refused if removing the
+// Machine chosen for remediation would drop the control plane below etcd quorum. Member removal and leadership
+// forwarding go through datastoreProvider; the quorum check queries etcd through the workload cluster directly.
+func (r *KThreesControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.Context, controlPlane *k3s.ControlPlane, datastoreProvider k3s.DatastoreProvider) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if controlPlane.IsRollingOut() {
+		log.Info("rollout in progress, skipping remediation")
+		return ctrl.Result{}, nil
+	}
+
+	unhealthy := controlPlane.UnhealthyMachinesForRemediation()
+	if len(unhealthy) == 0 {
+		return ctrl.Result{}, nil
+	}
+	machineToRemediate := unhealthy[0]
+
+	kcp := controlPlane.KCP
+	strategy := remediationStrategyOrDefault(kcp.Spec.RemediationStrategy)
+
+	retries := parseRemediationRetries(kcp.Annotations[controlplanev1.RemediationInProgressAnnotation])
+	retries = pruneRemediationRetries(retries, strategy.MinHealthyPeriod)
+	if int32(len(retries)) >= strategy.MaxRetry {
+		return ctrl.Result{}, r.failRemediation(ctx, kcp, errors.New("remediation MaxRetry exceeded, refusing to remediate further"))
+	}
+	if len(retries) > 0 && time.Since(retries[len(retries)-1]) < strategy.RetryPeriod {
+		return ctrl.Result{RequeueAfter: strategy.RetryPeriod - time.Since(retries[len(retries)-1])}, nil
+	}
+
+	workload, err := controlPlane.GetWorkloadCluster(ctx)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to get remote client for workload cluster")
+	}
+
+	// Only machineToRemediate's etcd member is removed by this call, so the quorum check only needs to account
+	// for losing that one member, not every currently-unhealthy Machine: the rest stay in place until their own
+	// turn. This queries actual etcd membership rather than counting Machine objects, since a Machine can look
+	// safe to remove while its Node (and etcd member) has already gone unhealthy, or vice versa.
+	nodeName := ""
+	if machineToRemediate.Status.NodeRef != nil {
+		nodeName = machineToRemediate.Status.NodeRef.Name
+	}
+	if hasQuorum, err := workload.HasEtcdQuorumExcluding(ctx, nodeName); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to check etcd quorum before remediating")
+	} else if !hasQuorum {
+		return ctrl.Result{}, r.failRemediation(ctx, kcp, errors.New("removing this machine would drop the control plane below etcd quorum, refusing to remediate"))
+	}
+
+	if leaderCandidate := controlPlane.HealthyMachineOtherThan(machineToRemediate); leaderCandidate != nil {
+		if err := datastoreProvider.ForwardLeadership(ctx, machineToRemediate, leaderCandidate); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to forward etcd leadership off unhealthy machine")
+		}
+	}
+
+	if nodeName != "" {
+		if _, err := datastoreProvider.RemoveMemberForNode(ctx, nodeName); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to remove etcd member for unhealthy machine")
+		}
+	}
+
+	conditions.MarkTrue(kcp, controlplanev1.RemediationCondition)
+	if err := r.Client.Status().Update(ctx, kcp); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to record remediation-in-progress condition")
+	}
+
+	log.Info("deleting unhealthy control plane machine for remediation", "machine", machineToRemediate.Name)
+	if err := r.Client.Delete(ctx, machineToRemediate); err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, errors.Wrap(err, "failed to delete unhealthy machine")
+	}
+
+	retries = append(retries, time.Now())
+	return ctrl.Result{}, r.recordRemediationRetries(ctx, kcp, retries)
+}
+
+// failRemediation marks RemediationCondition False with RemediationFailedReason so the refusal to remediate is
+// visible on the KThreesControlPlane, then returns cause unchanged for the caller to propagate.
+func (r *KThreesControlPlaneReconciler) failRemediation(ctx context.Context, kcp *controlplanev1.KThreesControlPlane, cause error) error {
+	conditions.MarkFalse(kcp, controlplanev1.RemediationCondition, controlplanev1.RemediationFailedReason, clusterv1.ConditionSeverityWarning, "%s", cause.Error())
+	if err := r.Client.Status().Update(ctx, kcp); err != nil {
+		return errors.Wrap(err, "failed to record remediation-failed condition")
+	}
+	return cause
+}
+
+func remediationStrategyOrDefault(strategy *controlplanev1.RemediationStrategy) struct {
+	MaxRetry         int32
+	RetryPeriod      time.Duration
+	MinHealthyPeriod time.Duration
+} {
+	result := struct {
+		MaxRetry         int32
+		RetryPeriod      time.Duration
+		MinHealthyPeriod time.Duration
+	}{
+		MaxRetry:         defaultRemediationMaxRetry,
+		RetryPeriod:      defaultRemediationRetryPeriod,
+		MinHealthyPeriod: defaultRemediationMinHealthyPeriod,
+	}
+	if strategy == nil {
+		return result
+	}
+	if strategy.MaxRetry != nil {
+		result.MaxRetry = *strategy.MaxRetry
+	}
+	if strategy.RetryPeriod.Duration > 0 {
+		result.RetryPeriod = strategy.RetryPeriod.Duration
+	}
+	if strategy.MinHealthyPeriod.Duration > 0 {
+		result.MinHealthyPeriod = strategy.MinHealthyPeriod.Duration
+	}
+	return result
+}
+
+// parseRemediationRetries decodes the RemediationInProgressAnnotation into a list of attempt timestamps, in the
+// order recordRemediationRetries wrote them (oldest first), so retries survive controller restarts.
+func parseRemediationRetries(value string) []time.Time {
+	if value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	retries := make([]time.Time, 0, len(parts))
+	for _, p := range parts {
+		if sec, err := strconv.ParseInt(p, 10, 64); err == nil {
+			retries = append(retries, time.Unix(sec, 0))
+		}
+	}
+	return retries
+}
+
+// pruneRemediationRetries drops retries older than minHealthyPeriod: once the control plane has been stable for
+// that long, earlier retries no longer count against MaxRetry.
+func pruneRemediationRetries(retries []time.Time, minHealthyPeriod time.Duration) []time.Time {
+	cutoff := time.Now().Add(-minHealthyPeriod)
+	pruned := retries[:0]
+	for _, t := range retries {
+		if t.After(cutoff) {
+			pruned = append(pruned, t)
+		}
+	}
+	return pruned
+}
+
+func (r *KThreesControlPlaneReconciler) recordRemediationRetries(ctx context.Context, kcp *controlplanev1.KThreesControlPlane, retries []time.Time) error {
+	values := make([]string, 0, len(retries))
+	for _, t := range retries {
+		values = append(values, strconv.FormatInt(t.Unix(), 10))
+	}
+	if kcp.Annotations == nil {
+		kcp.Annotations = map[string]string{}
+	}
+	kcp.Annotations[controlplanev1.RemediationInProgressAnnotation] = strings.Join(values, ",")
+	return r.Client.Update(ctx, kcp)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseRemediationRetries(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(parseRemediationRetries("")).To(BeNil())
+
+	now := time.Now()
+	value := "100,200,not-a-number,300"
+	retries := parseRemediationRetries(value)
+	g.Expect(retries).To(HaveLen(3), "the malformed entry should be skipped rather than failing the whole parse")
+	g.Expect(retries[0].Unix()).To(Equal(int64(100)))
+	g.Expect(retries[1].Unix()).To(Equal(int64(200)))
+	g.Expect(retries[2].Unix()).To(Equal(int64(300)))
+
+	_ = now
+}
+
+func TestPruneRemediationRetries(t *testing.T) {
+	g := NewWithT(t)
+
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now().Add(-time.Minute)
+
+	pruned := pruneRemediationRetries([]time.Time{old, recent}, time.Hour)
+	g.Expect(pruned).To(HaveLen(1))
+	g.Expect(pruned[0]).To(Equal(recent))
+
+	g.Expect(pruneRemediationRetries(nil, time.Hour)).To(BeEmpty())
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	"github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+const defaultEtcdSnapshotRetention = int32(5)
+
+// reconcileEtcdSnapshotSchedule is driven from the KThreesControlPlane reconcile loop for every control plane
+// that configures EtcdSnapshotSpec.Schedule. It takes a new snapshot once Schedule's cron expression says one is
+// due (tracked via the CreationTimestamp of the most recent KThreesEtcdSnapshot, to survive controller
+// restarts) and prunes snapshots beyond Retention.
+func (r *KThreesControlPlaneReconciler) reconcileEtcdSnapshotSchedule(ctx context.Context, workload *k3s.Workload, kcp *controlplanev1.KThreesControlPlane) error {
+	spec := kcp.Spec.EtcdSnapshot
+	if spec == nil || spec.Schedule == "" {
+		return nil
+	}
+
+	schedule, err := cron.ParseStandard(spec.Schedule)
+	if err != nil {
+		return errors.Wrapf(err, "invalid etcd snapshot schedule %q", spec.Schedule)
+	}
+
+	existing, err := r.listEtcdSnapshots(ctx, kcp)
+	if err != nil {
+		return errors.Wrap(err, "failed to list existing etcd snapshots")
+	}
+
+	if due(schedule, existing) {
+		if err := r.takeEtcdSnapshot(ctx, workload, kcp); err != nil {
+			return errors.Wrap(err, "failed to take scheduled etcd snapshot")
+		}
+	}
+
+	return r.pruneEtcdSnapshots(ctx, workload, kcp, retentionOrDefault(spec.Retention))
+}
+
+func (r *KThreesControlPlaneReconciler) listEtcdSnapshots(ctx context.Context, kcp *controlplanev1.KThreesControlPlane) ([]controlplanev1.KThreesEtcdSnapshot, error) {
+	list := &controlplanev1.KThreesEtcdSnapshotList{}
+	if err := r.Client.List(ctx, list,
+		client.InNamespace(kcp.Namespace),
+		client.MatchingLabels{clusterv1.ClusterNameLabel: kcp.Labels[clusterv1.ClusterNameLabel]},
+	); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].CreationTimestamp.After(list.Items[j].CreationTimestamp.Time)
+	})
+	return list.Items, nil
+}
+
+// due reports whether schedule's next firing time, computed from the most recent existing snapshot, has already
+// passed. If there are no existing snapshots yet, a snapshot is always due.
+func due(schedule cron.Schedule, existing []controlplanev1.KThreesEtcdSnapshot) bool {
+	if len(existing) == 0 {
+		return true
+	}
+	last := existing[0].CreationTimestamp.Time
+	return !schedule.Next(last).After(metav1.Now().Time)
+}
+
+func retentionOrDefault(retention *int32) int32 {
+	if retention == nil {
+		return defaultEtcdSnapshotRetention
+	}
+	return *retention
+}
+
+func (r *KThreesControlPlaneReconciler) takeEtcdSnapshot(ctx context.Context, workload *k3s.Workload, kcp *controlplanev1.KThreesControlPlane) error {
+	log := ctrl.LoggerFrom(ctx)
+	name := kcp.Name + "-" + metav1.Now().Format("20060102150405")
+
+	if err := workload.CreateEtcdSnapshot(ctx, name, kcp.Spec.EtcdSnapshot.S3); err != nil {
+		return err
+	}
+
+	clusterName := kcp.Labels[clusterv1.ClusterNameLabel]
+	snapshot := &controlplanev1.KThreesEtcdSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: kcp.Namespace,
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: clusterName},
+		},
+		Spec: controlplanev1.KThreesEtcdSnapshotSpec{
+			ClusterName:  clusterName,
+			SnapshotName: name,
+		},
+		Status: controlplanev1.KThreesEtcdSnapshotStatus{
+			Ready:        true,
+			CreationTime: &metav1.Time{Time: metav1.Now().Time},
+		},
+	}
+	if err := r.Client.Create(ctx, snapshot); err != nil {
+		return errors.Wrap(err, "failed to record KThreesEtcdSnapshot")
+	}
+
+	log.Info("took etcd snapshot", "name", name)
+	return nil
+}
+
+func (r *KThreesControlPlaneReconciler) pruneEtcdSnapshots(ctx context.Context, workload *k3s.Workload, kcp *controlplanev1.KThreesControlPlane, retention int32) error {
+	existing, err := r.listEtcdSnapshots(ctx, kcp)
+	if err != nil {
+		return err
+	}
+	if int32(len(existing)) <= retention {
+		return nil
+	}
+
+	for _, snapshot := range existing[retention:] {
+		if err := workload.DeleteEtcdSnapshot(ctx, snapshot.Spec.SnapshotName, kcp.Spec.EtcdSnapshot.S3); err != nil {
+			return errors.Wrapf(err, "failed to delete etcd snapshot %q", snapshot.Spec.SnapshotName)
+		}
+		if err := r.Client.Delete(ctx, &snapshot); err != nil {
+			return errors.Wrapf(err, "failed to delete KThreesEtcdSnapshot %q", snapshot.Name)
+		}
+	}
+	return nil
+}
+
+// reconcileEtcdSnapshotRestore handles kcp.Spec.EtcdSnapshot.RestoreFromSnapshot: scale the control plane down to
+// one Machine, run the restore on the survivor, then clear RestoreFromSnapshot. This follows the k3s documented
+// disaster-recovery flow (`k3s server --cluster-reset --cluster-reset-restore-path=...`). This reconciler does
+// not create Machines, so it does not scale the control plane back up to kcp.Spec.Replicas afterwards.
+func (r *KThreesControlPlaneReconciler) reconcileEtcdSnapshotRestore(ctx context.Context, controlPlane *k3s.ControlPlane) (ctrl.Result, error) {
+	kcp := controlPlane.KCP
+	spec := kcp.Spec.EtcdSnapshot
+	if spec == nil || spec.RestoreFromSnapshot == nil {
+		return ctrl.Result{}, nil
+	}
+
+	survivor := restoreSurvivor(controlPlane)
+	if survivor == nil {
+		return ctrl.Result{}, errors.New("no control plane machine available to restore the etcd snapshot onto")
+	}
+	if survivor.Status.NodeRef == nil {
+		return ctrl.Result{}, errors.Errorf("restore survivor machine %q has no node ref yet", survivor.Name)
+	}
+
+	var toRemove []*clusterv1.Machine
+	for _, machine := range controlPlane.Machines.UnsortedList() {
+		if machine.Name != survivor.Name {
+			toRemove = append(toRemove, machine)
+		}
+	}
+	if len(toRemove) > 0 {
+		return r.scaleDownControlPlane(ctx, controlPlane, toRemove)
+	}
+
+	workload, err := controlPlane.GetWorkloadCluster(ctx)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to get remote client for workload cluster")
+	}
+
+	if err := workload.RestoreEtcdSnapshot(ctx, *spec.RestoreFromSnapshot, survivor.Status.NodeRef.Name, spec.S3); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to restore etcd snapshot")
+	}
+
+	kcp.Spec.EtcdSnapshot.RestoreFromSnapshot = nil
+	return ctrl.Result{}, r.Client.Update(ctx, kcp)
+}
+
+// restoreSurvivor deterministically picks the control plane Machine a restore runs on: the oldest Machine whose
+// Node is currently reporting healthy, or (if none are) the oldest Machine overall. Picking an arbitrary Machine
+// (e.g. via map iteration order) would make which node gets restored onto non-reproducible across reconciles.
+func restoreSurvivor(controlPlane *k3s.ControlPlane) *clusterv1.Machine {
+	if healthy := controlPlane.HealthyMachineOtherThan(nil); healthy != nil {
+		return healthy
+	}
+	sorted := controlPlane.Machines.SortedByCreationTimestamp()
+	if len(sorted) == 0 {
+		return nil
+	}
+	return sorted[0]
+}
+
+// scaleDownControlPlane deletes toRemove so the control plane is left with only the restore survivor. No
+// replacement Machines are created here or elsewhere in this reconciler.
+func (r *KThreesControlPlaneReconciler) scaleDownControlPlane(ctx context.Context, controlPlane *k3s.ControlPlane, toRemove []*clusterv1.Machine) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	for _, machine := range toRemove {
+		log.Info("deleting control plane machine to scale down for etcd snapshot restore", "machine", machine.Name)
+		if err := r.Client.Delete(ctx, machine); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to delete machine %q while scaling down for restore", machine.Name)
+		}
+	}
+	return ctrl.Result{Requeue: true}, nil
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+)
+
+func TestDue(t *testing.T) {
+	g := NewWithT(t)
+
+	schedule, err := cron.ParseStandard("@every 1h")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(due(schedule, nil)).To(BeTrue(), "no existing snapshot means one is always due")
+
+	recent := []controlplanev1.KThreesEtcdSnapshot{{
+		ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Minute))},
+	}}
+	g.Expect(due(schedule, recent)).To(BeFalse())
+
+	stale := []controlplanev1.KThreesEtcdSnapshot{{
+		ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Hour))},
+	}}
+	g.Expect(due(schedule, stale)).To(BeTrue())
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+)
+
+// ControlPlane holds the state a single KThreesControlPlane reconcile needs: the KCP object itself, its owning
+// Cluster, and the Machines it currently owns.
+type ControlPlane struct {
+	KCP      *controlplanev1.KThreesControlPlane
+	Cluster  *clusterv1.Cluster
+	Machines collections.Machines
+
+	client          ctrlclient.Client
+	workloadCluster *Workload
+}
+
+// NewControlPlane returns a ControlPlane wrapping kcp, cluster and the Machines it owns.
+func NewControlPlane(client ctrlclient.Client, cluster *clusterv1.Cluster, kcp *controlplanev1.KThreesControlPlane, ownedMachines collections.Machines) *ControlPlane {
+	return &ControlPlane{
+		KCP:      kcp,
+		Cluster:  cluster,
+		Machines: ownedMachines,
+		client:   client,
+	}
+}
+
+// GetWorkloadCluster returns the Workload for Cluster, building and caching it on first use.
+func (c *ControlPlane) GetWorkloadCluster(ctx context.Context) (*Workload, error) {
+	if c.workloadCluster != nil {
+		return c.workloadCluster, nil
+	}
+
+	workload, err := NewWorkloadCluster(ctx, c.client, c.Cluster)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build workload cluster client")
+	}
+	c.workloadCluster = workload
+	return c.workloadCluster, nil
+}
+
+// HealthyMachineOtherThan returns a control plane Machine other than excluded whose Node is reporting healthy, or
+// nil if there is none. It is used to pick a leadership-transfer candidate before excluded's etcd member (or the
+// Machine itself) is removed.
+func (c *ControlPlane) HealthyMachineOtherThan(excluded *clusterv1.Machine) *clusterv1.Machine {
+	for _, machine := range c.Machines.SortedByCreationTimestamp() {
+		if excluded != nil && machine.Name == excluded.Name {
+			continue
+		}
+		if machine.Status.NodeRef == nil {
+			continue
+		}
+		if conditions.IsTrue(machine, clusterv1.MachineNodeHealthyCondition) {
+			return machine
+		}
+	}
+	return nil
+}
+
+// IsRollingOut reports whether any Machine owned by the control plane is not yet on KCP.Spec.Version, i.e. a
+// rollout is already underway.
+func (c *ControlPlane) IsRollingOut() bool {
+	for _, machine := range c.Machines {
+		if machine.Spec.Version == nil || *machine.Spec.Version != c.KCP.Spec.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// UnhealthyMachinesForRemediation returns control plane Machines that a MachineHealthCheck has marked for owner
+// remediation, oldest first so remediation order is deterministic across reconciles.
+func (c *ControlPlane) UnhealthyMachinesForRemediation() []*clusterv1.Machine {
+	return c.Machines.Filter(collections.HasUnhealthyCondition).SortedByCreationTimestamp()
+}
@@ -19,10 +19,13 @@ package k3s
 import (
 	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -34,8 +37,36 @@ import (
 const (
 	EtcdRemoveAnnotation      = "etcd.k3s.cattle.io/remove"
 	EtcdRemovedNodeAnnotation = "etcd.k3s.cattle.io/removed-node-name"
+
+	// PreTerminateHookCleanupAnnotation is set by the KThreesControlPlane controller, on each reconcile, on every
+	// control plane Machine that is not being deleted and lacks it; it is not set when the Machine is created,
+	// so a Machine deleted before it has been reconciled is not gated by it. Cluster API
+	// will not proceed with Machine (and therefore InfraMachine) deletion while this annotation is present,
+	// which gives the KThreesControlPlane controller a chance to remove the Machine's etcd member before the
+	// underlying node is torn down. The controller removes the annotation once it has confirmed the member is
+	// gone, at which point CAPI resumes the deletion.
+	PreTerminateHookCleanupAnnotation = "pre-terminate.delete.hook.machine.cluster.x-k8s.io/kthreescontrolplane"
+
+	// etcdMemberAuditTimeout is how long after its creation a control plane Machine may go without a NodeRef
+	// before AuditEtcdMembers considers the unmatched etcd member paired with it orphaned and force-removes it by
+	// member ID. The etcd member's own age is not measured.
+	etcdMemberAuditTimeout = 10 * time.Minute
 )
 
+// EnsurePreTerminateHookAnnotation sets PreTerminateHookCleanupAnnotation on machine if it is not already present,
+// returning true if the annotation was added. The KThreesControlPlane controller calls it on each reconcile for
+// every control plane Machine not being deleted, so that its eventual deletion is gated on etcd member removal.
+func EnsurePreTerminateHookAnnotation(machine *clusterv1.Machine) bool {
+	if _, ok := machine.Annotations[PreTerminateHookCleanupAnnotation]; ok {
+		return false
+	}
+	if machine.Annotations == nil {
+		machine.Annotations = map[string]string{}
+	}
+	machine.Annotations[PreTerminateHookCleanupAnnotation] = ""
+	return true
+}
+
 type etcdClientFor interface {
 	forFirstAvailableNode(ctx context.Context, nodeNames []string) (*etcd.Client, error)
 	forLeader(ctx context.Context, nodeNames []string) (*etcd.Client, error)
@@ -189,6 +220,43 @@ func (w *Workload) removeMemberForNode(ctx context.Context, name string) (bool,
 	return false, nil
 }
 
+// EtcdMemberRemovedForMachine returns true if machine's node no longer has a corresponding etcd member, i.e. it is
+// safe for the pre-terminate hook to release the Machine for deletion. It returns true, rather than an error, if
+// the Machine never had a node (nothing to confirm).
+func (w *Workload) EtcdMemberRemovedForMachine(ctx context.Context, machine *clusterv1.Machine) (bool, error) {
+	if machine == nil || machine.Status.NodeRef == nil {
+		return true, nil
+	}
+
+	controlPlaneNodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var remainingNodes []string
+	for _, n := range controlPlaneNodes.Items {
+		if n.Name != machine.Status.NodeRef.Name {
+			remainingNodes = append(remainingNodes, n.Name)
+		}
+	}
+	if len(remainingNodes) == 0 {
+		return false, ErrControlPlaneMinNodes
+	}
+
+	etcdClient, err := w.etcdClientGenerator.forFirstAvailableNode(ctx, remainingNodes)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	return etcdutil.MemberForName(members, machine.Status.NodeRef.Name) == nil, nil
+}
+
 // ForwardEtcdLeadership forwards etcd leadership to the first follower.
 func (w *Workload) ForwardEtcdLeadership(ctx context.Context, machine *clusterv1.Machine, leaderCandidate *clusterv1.Machine) error {
 	if machine == nil || machine.Status.NodeRef == nil {
@@ -236,3 +304,146 @@ func (w *Workload) ForwardEtcdLeadership(ctx context.Context, machine *clusterv1
 	}
 	return nil
 }
+
+// HasEtcdQuorumExcluding reports whether the etcd cluster would still have a healthy majority if the member for
+// nodeName were removed. Unlike a count of control plane Machines, this reflects actual etcd membership: a
+// Machine can look safe to remove while its Node (and etcd member) has already gone unhealthy, or vice versa.
+func (w *Workload) HasEtcdQuorumExcluding(ctx context.Context, nodeName string) (bool, error) {
+	controlPlaneNodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var remainingNodes []string
+	for _, n := range controlPlaneNodes.Items {
+		if n.Name != nodeName {
+			remainingNodes = append(remainingNodes, n.Name)
+		}
+	}
+	if len(remainingNodes) == 0 {
+		return false, ErrControlPlaneMinNodes
+	}
+
+	etcdClient, err := w.etcdClientGenerator.forFirstAvailableNode(ctx, remainingNodes)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	// Listing members goes through consensus, so this also confirms the remaining members are actually healthy
+	// enough to reach quorum, not just present.
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	remaining := len(members)
+	if etcdutil.MemberForName(members, nodeName) != nil {
+		remaining--
+	}
+	quorum := len(members)/2 + 1
+	return remaining >= quorum, nil
+}
+
+// AuditEtcdMembers looks for etcd members that do not correspond to any current control plane node and are old
+// enough to no longer be considered "just joined", and force-removes them by member ID. Unlike
+// reconcileEtcdMember, which only acts on members it can match back to a node name, this also catches members
+// whose node never registered at all (empty name), which would otherwise wedge etcd quorum forever if the
+// owning Machine never finishes bootstrapping.
+func (w *Workload) AuditEtcdMembers(ctx context.Context, machines []*clusterv1.Machine) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	controlPlaneNodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return err
+	}
+	if len(controlPlaneNodes.Items) < 2 {
+		// Force-removing a member would drop us below quorum; removeMemberForNonExistingNode applies the same
+		// guard for the node-name path, so mirror it here.
+		return ErrControlPlaneMinNodes
+	}
+	nodeNames := make([]string, 0, len(controlPlaneNodes.Items))
+	knownNodes := sets.New[string]()
+	for _, n := range controlPlaneNodes.Items {
+		nodeNames = append(nodeNames, n.Name)
+		knownNodes.Insert(n.Name)
+	}
+
+	etcdClient, err := w.etcdClientGenerator.forLeader(ctx, nodeNames)
+	if err != nil {
+		return errors.Wrap(err, "failed to create etcd client")
+	}
+	defer etcdClient.Close()
+
+	members, err := etcdClient.Members(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list etcd members using etcd client")
+	}
+
+	// Pair each unmatched member against a still-bootstrapping (NodeRef == nil) Machine, oldest first. etcd
+	// assigns a member its name/ID in roughly join order, so this gives every unmatched member its own candidate
+	// Machine to be timed out against, instead of one stuck Machine's age condemning every unmatched member
+	// across the cluster.
+	pending := pendingMachines(machines)
+
+	var errs []error
+	pendingIdx := 0
+	for _, member := range members {
+		name := etcdutil.NodeNameFromMember(member)
+		if name != "" && knownNodes.Has(name) {
+			continue
+		}
+
+		var candidate *clusterv1.Machine
+		if pendingIdx < len(pending) {
+			candidate = pending[pendingIdx]
+			pendingIdx++
+		}
+		if !etcdMemberIsOrphaned(candidate) {
+			continue
+		}
+
+		log.Info("force-removing orphan etcd member", "memberID", member.ID, "node", name)
+		if err := w.forceRemoveMemberByID(ctx, etcdClient, member.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return kerrors.NewAggregate(errs)
+}
+
+// pendingMachines returns the machines that have not yet registered a Node (Status.NodeRef == nil), oldest
+// first, so AuditEtcdMembers can pair them against unmatched etcd members in join order.
+func pendingMachines(machines []*clusterv1.Machine) []*clusterv1.Machine {
+	var pending []*clusterv1.Machine
+	for _, machine := range machines {
+		if machine.Status.NodeRef == nil {
+			pending = append(pending, machine)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreationTimestamp.Before(&pending[j].CreationTimestamp)
+	})
+	return pending
+}
+
+// etcdMemberIsOrphaned reports whether an unmatched etcd member should be force-removed, given the
+// still-bootstrapping Machine it was paired with by AuditEtcdMembers. candidate is nil when there are more
+// unmatched members than pending Machines to explain them, in which case there is no innocent explanation left
+// and the member is orphaned outright. Otherwise the member is only orphaned once its candidate Machine has gone
+// longer than etcdMemberAuditTimeout without a NodeRef — before that, the member may simply still be joining.
+func etcdMemberIsOrphaned(candidate *clusterv1.Machine) bool {
+	if candidate == nil {
+		return true
+	}
+	return time.Since(candidate.CreationTimestamp.Time) > etcdMemberAuditTimeout
+}
+
+// forceRemoveMemberByID removes an etcd member directly by ID against an already-open client, bypassing the
+// node-name lookup that removeMemberForNonExistingNode relies on.
+func (w *Workload) forceRemoveMemberByID(ctx context.Context, etcdClient *etcd.Client, memberID uint64) error {
+	if err := etcdClient.RemoveMember(ctx, memberID); err != nil {
+		return errors.Wrapf(err, "failed to force-remove etcd member %d", memberID)
+	}
+	return nil
+}
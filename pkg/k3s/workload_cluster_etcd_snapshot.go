@@ -0,0 +1,225 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+)
+
+// etcdSnapshotJobImage is the image used for the Jobs that run `k3s etcd-snapshot` on a control plane node. It
+// matches the node's own k3s binary by running in the host's mount/PID namespace rather than shipping its own
+// k3s version.
+const etcdSnapshotJobImage = "busybox:1.36"
+
+// etcdSnapshotJobTTL is how long a finished etcd snapshot Job (and its Pod) is kept around before the Kubernetes
+// TTL controller garbage collects it. Without this, every scheduled snapshot leaves a Job and Pod behind forever.
+const etcdSnapshotJobTTL = int32(15 * 60)
+
+// CreateEtcdSnapshot runs `k3s etcd-snapshot save --name <name>` on a control plane node via a privileged Job,
+// and waits for it to complete. If s3 is set, the snapshot is additionally uploaded to the configured bucket.
+func (w *Workload) CreateEtcdSnapshot(ctx context.Context, name string, s3 *controlplanev1.EtcdSnapshotS3Spec) error {
+	return w.runEtcdSnapshotJob(ctx, fmt.Sprintf("etcd-snapshot-save-%s", name), "", []string{
+		"etcd-snapshot", "save", "--name", name,
+	}, s3, false)
+}
+
+// ListEtcdSnapshots runs `k3s etcd-snapshot ls` on a control plane node. The command's own stdout (the snapshot
+// listing) is left in the Job's Pod logs rather than streamed back here, since CreateEtcdSnapshot/
+// DeleteEtcdSnapshot/RestoreEtcdSnapshot only need the Job's success/failure and plumbing log streaming through
+// would be unused outside of this one read path.
+func (w *Workload) ListEtcdSnapshots(ctx context.Context, s3 *controlplanev1.EtcdSnapshotS3Spec) error {
+	return w.runEtcdSnapshotJob(ctx, "etcd-snapshot-ls", "", []string{"etcd-snapshot", "ls"}, s3, false)
+}
+
+// DeleteEtcdSnapshot runs `k3s etcd-snapshot delete <name>` on a control plane node.
+func (w *Workload) DeleteEtcdSnapshot(ctx context.Context, name string, s3 *controlplanev1.EtcdSnapshotS3Spec) error {
+	return w.runEtcdSnapshotJob(ctx, fmt.Sprintf("etcd-snapshot-delete-%s", name), "", []string{
+		"etcd-snapshot", "delete", name,
+	}, s3, false)
+}
+
+// RestoreEtcdSnapshot restores the named snapshot by running `k3s server --cluster-reset
+// --cluster-reset-restore-path=<name>` on nodeName. Callers are responsible for scaling the control plane down
+// to a single node beforehand (and passing that survivor's node name here) and back up afterwards, mirroring the
+// k3s documented DR flow. The already-running k3s service on that node is stopped first: k3s's own cluster-reset
+// flow requires the server not already be running, and leaving it up would race the reset against the live
+// process.
+func (w *Workload) RestoreEtcdSnapshot(ctx context.Context, name, nodeName string, s3 *controlplanev1.EtcdSnapshotS3Spec) error {
+	return w.runEtcdSnapshotJob(ctx, fmt.Sprintf("etcd-snapshot-restore-%s", name), nodeName, []string{
+		"server", "--cluster-reset", fmt.Sprintf("--cluster-reset-restore-path=%s", name),
+	}, s3, true)
+}
+
+// runEtcdSnapshotJob runs a k3s command to completion as a privileged Job, using the host filesystem and PID
+// namespace of nodeName so it operates on the same k3s data directory the running server uses. If nodeName is
+// empty, the first control plane node is used instead (fine for commands like save/ls/delete that aren't tied to
+// a specific survivor). When stopK3sFirst is true, the running k3s service on that node is stopped before the
+// command runs.
+func (w *Workload) runEtcdSnapshotJob(ctx context.Context, jobName, nodeName string, k3sArgs []string, s3 *controlplanev1.EtcdSnapshotS3Spec, stopK3sFirst bool) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	if nodeName == "" {
+		controlPlaneNodes, err := w.getControlPlaneNodes(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list control plane nodes")
+		}
+		if len(controlPlaneNodes.Items) == 0 {
+			return errors.New("no control plane nodes available to run etcd snapshot job on")
+		}
+		nodeName = controlPlaneNodes.Items[0].Name
+	}
+
+	env, err := w.etcdSnapshotS3Env(ctx, s3)
+	if err != nil {
+		return errors.Wrap(err, "failed to build etcd snapshot S3 credentials")
+	}
+	args := append(append([]string{}, k3sArgs...), etcdSnapshotS3Args(s3)...)
+
+	job := etcdSnapshotJob(jobName, nodeName, args, env, stopK3sFirst)
+	if err := w.Client.Create(ctx, job); err != nil {
+		return errors.Wrapf(err, "failed to create etcd snapshot job %q", jobName)
+	}
+
+	log.Info("waiting for etcd snapshot job to complete", "job", jobName, "node", nodeName)
+	return wait.PollUntilContextCancel(ctx, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		current := &batchv1.Job{}
+		if err := w.Client.Get(ctx, client.ObjectKeyFromObject(job), current); err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if current.Status.Succeeded > 0 {
+			return true, nil
+		}
+		if current.Status.Failed > 0 {
+			return false, errors.Errorf("etcd snapshot job %q failed", jobName)
+		}
+		return false, nil
+	})
+}
+
+// etcdSnapshotS3Args builds the `k3s etcd-snapshot`/`k3s server` flags that point at an S3-compatible bucket, or
+// nil if s3 is unset.
+func etcdSnapshotS3Args(s3 *controlplanev1.EtcdSnapshotS3Spec) []string {
+	if s3 == nil {
+		return nil
+	}
+	args := []string{
+		"--etcd-s3",
+		"--etcd-s3-endpoint=" + s3.Endpoint,
+		"--etcd-s3-bucket=" + s3.Bucket,
+	}
+	if s3.Region != "" {
+		args = append(args, "--etcd-s3-region="+s3.Region)
+	}
+	return args
+}
+
+// etcdSnapshotS3Env resolves s3.AccessKeySecretRef into the AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY environment
+// variables k3s reads for S3 credentials, or nil if s3 is unset. The secret may live outside the Job's
+// kube-system namespace, so its contents are read up front rather than referenced in-place via secretKeyRef.
+func (w *Workload) etcdSnapshotS3Env(ctx context.Context, s3 *controlplanev1.EtcdSnapshotS3Spec) ([]corev1.EnvVar, error) {
+	if s3 == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: s3.AccessKeySecretRef.Namespace, Name: s3.AccessKeySecretRef.Name}
+	if err := w.Client.Get(ctx, key, secret); err != nil {
+		return nil, errors.Wrap(err, "failed to get etcd snapshot S3 access key secret")
+	}
+
+	return []corev1.EnvVar{
+		{Name: "AWS_ACCESS_KEY_ID", Value: string(secret.Data["accessKey"])},
+		{Name: "AWS_SECRET_ACCESS_KEY", Value: string(secret.Data["secretKey"])},
+	}, nil
+}
+
+func etcdSnapshotJob(jobName, nodeName string, k3sArgs []string, env []corev1.EnvVar, stopK3sFirst bool) *batchv1.Job {
+	privileged := true
+	backoffLimit := int32(1)
+	ttl := etcdSnapshotJobTTL
+
+	nsenter := append([]string{
+		"nsenter", "--target", "1", "--mount", "--uts", "--ipc", "--net", "--pid", "--", "k3s",
+	}, k3sArgs...)
+
+	command := []string{"sh", "-c"}
+	shellCmd := shellQuoteJoin(nsenter)
+	if stopK3sFirst {
+		// k3s's documented cluster-reset flow requires the node's own k3s service not already be running;
+		// otherwise the reset races the live process over the same data directory.
+		shellCmd = "nsenter --target 1 --mount --uts --ipc --net --pid -- systemctl stop k3s || true; " + shellCmd
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: metav1.NamespaceSystem,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					HostPID:       true,
+					NodeName:      nodeName,
+					RestartPolicy: corev1.RestartPolicyNever,
+					Tolerations: []corev1.Toleration{
+						{Operator: corev1.TolerationOpExists},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "k3s-etcd-snapshot",
+							Image:   etcdSnapshotJobImage,
+							Command: append(command, shellCmd),
+							Env:     env,
+							SecurityContext: &corev1.SecurityContext{
+								Privileged: &privileged,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// shellQuoteJoin joins args into a single `sh -c` command line, single-quoting each argument so values
+// containing spaces (e.g. --cluster-reset-restore-path=<name>) survive the shell step intact.
+func shellQuoteJoin(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, a := range args {
+		quoted = append(quoted, "'"+strings.ReplaceAll(a, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
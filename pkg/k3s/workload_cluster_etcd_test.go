@@ -0,0 +1,66 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func machineWithAge(name string, age time.Duration, hasNodeRef bool) *clusterv1.Machine {
+	m := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		},
+	}
+	if hasNodeRef {
+		m.Status.NodeRef = &corev1.ObjectReference{Name: name}
+	}
+	return m
+}
+
+func TestEtcdMemberIsOrphaned(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(etcdMemberIsOrphaned(nil)).To(BeTrue(), "no candidate machine left to explain the member means there is no innocent explanation")
+
+	recent := machineWithAge("m1", time.Minute, false)
+	g.Expect(etcdMemberIsOrphaned(recent)).To(BeFalse(), "a machine created a minute ago that has no node ref yet should not be treated as orphaned")
+
+	stale := machineWithAge("m1", etcdMemberAuditTimeout+time.Minute, false)
+	g.Expect(etcdMemberIsOrphaned(stale)).To(BeTrue())
+}
+
+func TestPendingMachines(t *testing.T) {
+	g := NewWithT(t)
+
+	healthy := machineWithAge("m1", time.Hour, true)
+	g.Expect(pendingMachines([]*clusterv1.Machine{healthy})).To(BeEmpty(), "machines with a node ref are not pending")
+
+	older := machineWithAge("m2", etcdMemberAuditTimeout+time.Minute, false)
+	newer := machineWithAge("m3", time.Minute, false)
+	pending := pendingMachines([]*clusterv1.Machine{newer, healthy, older})
+	g.Expect(pending).To(HaveLen(2))
+	g.Expect(pending[0].Name).To(Equal("m2"), "oldest pending machine should be paired against the first unmatched member")
+	g.Expect(pending[1].Name).To(Equal("m3"))
+}